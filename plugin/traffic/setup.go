@@ -0,0 +1,188 @@
+package traffic
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/coredns/caddy"
+	"github.com/coredns/coredns/core/dnsserver"
+	"github.com/coredns/coredns/plugin"
+	"github.com/coredns/coredns/plugin/traffic/xds"
+)
+
+func init() { plugin.Register("traffic", setup) }
+
+func setup(c *caddy.Controller) error {
+	t, err := parseTraffic(c)
+	if err != nil {
+		return plugin.Error("traffic", err)
+	}
+
+	c.OnShutdown(func() error {
+		t.Close()
+		return nil
+	})
+
+	dnsserver.GetConfig(c).AddPlugin(func(next plugin.Handler) plugin.Handler {
+		t.Next = next
+		return t
+	})
+
+	return nil
+}
+
+// parseTraffic parses a "traffic" Corefile stanza:
+//
+//	traffic [ADDRESS] {
+//	    node ID [CLUSTER]
+//	    locality REGION [ZONE [SUBZONE]]
+//	    metadata KEY VALUE
+//	    channel_creds insecure|google_default
+//	    channel_creds tls [ca_file=PATH] [certificate_file=PATH] [private_key_file=PATH] [server_name=NAME]
+//	    version v2|v3
+//	    delta
+//	}
+//
+// ADDRESS is the xDS management server to dial, defaulting to ":18000". node/locality/
+// metadata/channel_creds build an inline bootstrap configuration equivalent to (and
+// taking priority over) $GRPC_XDS_BOOTSTRAP; without any of them, Traffic is built by
+// New, which uses $GRPC_XDS_BOOTSTRAP if set and otherwise an insecure connection
+// identified as node "mycoredns". version/delta select the wire version and protocol
+// (see xds.Client.SetVersion/SetDelta); both default to v2 State-of-the-World, and
+// delta always uses v3 wire types.
+func parseTraffic(c *caddy.Controller) (*Traffic, error) {
+	addr := ":18000"
+	node := "mycoredns"
+	version := ""
+	delta := false
+	var b *xds.Bootstrap
+	var channelCreds []xds.BootstrapChannelCreds
+
+	bootstrap := func() *xds.Bootstrap {
+		if b == nil {
+			b = &xds.Bootstrap{}
+		}
+		return b
+	}
+
+	for c.Next() {
+		args := c.RemainingArgs()
+		switch len(args) {
+		case 0:
+		case 1:
+			addr = args[0]
+		default:
+			return nil, c.ArgErr()
+		}
+
+		for c.NextBlock() {
+			switch c.Val() {
+			case "node":
+				args := c.RemainingArgs()
+				if len(args) == 0 || len(args) > 2 {
+					return nil, c.ArgErr()
+				}
+				bootstrap().Node.ID = args[0]
+				if len(args) == 2 {
+					bootstrap().Node.Cluster = args[1]
+				}
+			case "locality":
+				args := c.RemainingArgs()
+				if len(args) == 0 || len(args) > 3 {
+					return nil, c.ArgErr()
+				}
+				loc := &xds.BootstrapLocality{Region: args[0]}
+				if len(args) > 1 {
+					loc.Zone = args[1]
+				}
+				if len(args) > 2 {
+					loc.SubZone = args[2]
+				}
+				bootstrap().Node.Locality = loc
+			case "metadata":
+				args := c.RemainingArgs()
+				if len(args) != 2 {
+					return nil, c.ArgErr()
+				}
+				n := bootstrap()
+				if n.Node.Metadata == nil {
+					n.Node.Metadata = make(map[string]string)
+				}
+				n.Node.Metadata[args[0]] = args[1]
+			case "channel_creds":
+				args := c.RemainingArgs()
+				if len(args) == 0 {
+					return nil, c.ArgErr()
+				}
+				cc, err := parseChannelCreds(args)
+				if err != nil {
+					return nil, err
+				}
+				bootstrap() // ensure an inline bootstrap exists even if this is the only directive
+				channelCreds = append(channelCreds, cc)
+			case "version":
+				args := c.RemainingArgs()
+				if len(args) != 1 {
+					return nil, c.ArgErr()
+				}
+				version = args[0]
+			case "delta":
+				if len(c.RemainingArgs()) != 0 {
+					return nil, c.ArgErr()
+				}
+				delta = true
+			default:
+				return nil, c.ArgErr()
+			}
+		}
+	}
+
+	var opts []Option
+	if version != "" {
+		opts = append(opts, Version(version))
+	}
+	if delta {
+		opts = append(opts, Delta())
+	}
+
+	if b == nil {
+		return New(addr, node, opts...)
+	}
+	b.XDSServers = []xds.BootstrapXDSServer{{ServerURI: addr, ChannelCreds: channelCreds}}
+	return NewFromBootstrap(b, opts...)
+}
+
+// parseChannelCreds parses one "channel_creds" directive's arguments into a
+// xds.BootstrapChannelCreds: the first argument is the type ("insecure",
+// "google_default" or "tls"); for "tls" the rest are key=value pairs matching
+// xds.BootstrapTLSConfig's fields.
+func parseChannelCreds(args []string) (xds.BootstrapChannelCreds, error) {
+	typ := args[0]
+	if typ != "tls" {
+		if len(args) > 1 {
+			return xds.BootstrapChannelCreds{}, fmt.Errorf("channel_creds %s takes no arguments", typ)
+		}
+		return xds.BootstrapChannelCreds{Type: typ}, nil
+	}
+
+	var cfg xds.BootstrapTLSConfig
+	for _, kv := range args[1:] {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			return xds.BootstrapChannelCreds{}, fmt.Errorf("channel_creds tls: expected key=value, got %q", kv)
+		}
+		switch k {
+		case "ca_file":
+			cfg.CACertificateFile = v
+		case "certificate_file":
+			cfg.CertificateFile = v
+		case "private_key_file":
+			cfg.PrivateKeyFile = v
+		case "server_name":
+			cfg.ServerNameOverride = v
+		default:
+			return xds.BootstrapChannelCreds{}, fmt.Errorf("channel_creds tls: unknown key %q", k)
+		}
+	}
+	return xds.BootstrapChannelCreds{Type: "tls", Config: cfg}, nil
+}
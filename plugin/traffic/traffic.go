@@ -18,12 +18,55 @@ type Traffic struct {
 	Next plugin.Handler
 }
 
-// New returns a pointer to a new and initialized Traffic.
-func New(addr, node string) (*Traffic, error) {
-	c, err := xds.New(":18000", "mycoredns")
+// Option configures optional xds.Client behavior for New and NewFromBootstrap, applied
+// before the client starts connecting.
+type Option func(*xds.Client)
+
+// Version sets the xDS wire version the client speaks: "v2" (default) or "v3".
+func Version(version string) Option {
+	return func(c *xds.Client) { c.SetVersion(version) }
+}
+
+// Delta selects the Delta/Incremental ADS protocol instead of State-of-the-World.
+func Delta() Option {
+	return func(c *xds.Client) { c.SetDelta(true) }
+}
+
+// New returns a pointer to a new and initialized Traffic. If $GRPC_XDS_BOOTSTRAP points
+// at a bootstrap file, its node identity and channel credentials are used; otherwise
+// it falls back to an insecure connection to addr with node as the Node ID.
+func New(addr, node string, opts ...Option) (*Traffic, error) {
+	if b, err := xds.LoadBootstrapFromEnv(); err != nil {
+		return nil, err
+	} else if b != nil {
+		return NewFromBootstrap(b, opts...)
+	}
+
+	c, err := xds.New(addr, node)
 	if err != nil {
 		return nil, err
 	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	go c.Connect()
+	go c.RunLRSWithRetry()
+
+	return &Traffic{c: c}, nil
+}
+
+// NewFromBootstrap is New, but using an explicit bootstrap configuration instead of
+// $GRPC_XDS_BOOTSTRAP - e.g. one built from inline Corefile directives by setup.go.
+func NewFromBootstrap(b *xds.Bootstrap, opts ...Option) (*Traffic, error) {
+	c, err := xds.NewFromBootstrap(b)
+	if err != nil {
+		return nil, err
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	go c.Connect()
+	go c.RunLRSWithRetry()
 
 	return &Traffic{c: c}, nil
 }
@@ -37,10 +80,12 @@ func (t *Traffic) ServeDNS(ctx context.Context, w dns.ResponseWriter, r *dns.Msg
 	state := request.Request{Req: r, W: w}
 
 	cluster, _ := dnsutil.TrimZone(state.Name(), "example.org")
-	addr := t.c.Select(cluster)
+	addr, locality := t.c.SelectLocality(cluster)
 	if addr == nil {
+		t.c.RecordOutcome(cluster, locality, false)
 		return plugin.NextOrFailure(t.Name(), t.Next, ctx, w, r)
 	}
+	t.c.RecordOutcome(cluster, locality, true)
 
 	log.Debugf("Found address %q for %q", addr, cluster)
 
@@ -0,0 +1,105 @@
+package xds
+
+import (
+	"context"
+	"time"
+)
+
+// Resource type URLs, v2 and v3. The v3 ones additionally double as the Delta
+// resource type used in DeltaDiscoveryRequest/DeltaDiscoveryResponse.
+const (
+	clusterTypeURLv2  = "type.googleapis.com/envoy.api.v2.Cluster"
+	endpointTypeURLv2 = "type.googleapis.com/envoy.api.v2.ClusterLoadAssignment"
+
+	clusterTypeURLv3  = "type.googleapis.com/envoy.config.cluster.v3.Cluster"
+	endpointTypeURLv3 = "type.googleapis.com/envoy.config.endpoint.v3.ClusterLoadAssignment"
+)
+
+// clusterDiscoveryType mirrors envoy.api.v2.Cluster.DiscoveryType /
+// envoy.config.cluster.v3.Cluster.DiscoveryType, trimmed to what Client acts on.
+type clusterDiscoveryType int
+
+const (
+	// clusterEDS is resolved over the shared ADS stream, the common case.
+	clusterEDS clusterDiscoveryType = iota
+	// clusterStrictDNS and clusterLogicalDNS are resolved by Client itself via
+	// net.Resolver, refreshed on a timer, instead of via EDS.
+	clusterStrictDNS
+	clusterLogicalDNS
+	// clusterOther covers STATIC/ORIGINAL_DST and anything else Client doesn't
+	// actively resolve.
+	clusterOther
+)
+
+// cluster is the version-independent subset of a CDS resource that Client cares about.
+type cluster struct {
+	name string
+	typ  clusterDiscoveryType
+
+	// dnsHostnames and dnsRefreshRate are only set for clusterStrictDNS/clusterLogicalDNS
+	// clusters: the hostnames to resolve ourselves, and how often to redo it.
+	dnsHostnames   []string
+	dnsRefreshRate time.Duration
+
+	// edsViaADS is only meaningful for clusterEDS: true if the cluster's
+	// eds_cluster_config.eds_config points at our own ADS stream (the only source
+	// Client knows how to follow); false means it named a different source and Client
+	// should skip it rather than requesting it on the main stream.
+	edsViaADS bool
+}
+
+// discoveryResponse is what a RecvResponse call is normalized into, regardless of
+// whether it came off a SotW DiscoveryResponse or a DeltaDiscoveryResponse.
+type discoveryResponse struct {
+	typeURL string
+	version string // VersionInfo (SotW); empty for delta, whose per-resource versions RecvResponse records in Client.deltaVersions
+	nonce   string
+
+	clusters    []cluster                 // populated when typeURL is a CDS type
+	assignments map[string]*clusterLoadAssignment // populated when typeURL is an EDS type, keyed by cluster name
+	removed     []string                  // delta only: resource names removed since the last response
+
+	// parseErr is set when one or more resources in the response failed to parse.
+	// HandleResponse NACKs the whole response when this is non-nil, rather than
+	// applying the resources that did parse - the management server is expected to
+	// resend a corrected version.
+	parseErr error
+}
+
+// apiClient is implemented once per supported xDS wire version and ADS protocol
+// variant (State-of-the-World or Delta/Incremental). Client talks to the management
+// server exclusively through this interface, so the rest of the package doesn't need
+// to know which one is actually in use. The concrete implementations live in v2.go,
+// v3.go (SotW) and delta.go (Delta, v3 wire types whatever the configured version).
+type apiClient interface {
+	// Run dials the ADS stream. It must succeed before SendRequest/RecvResponse are used.
+	Run(ctx context.Context) error
+
+	// SendRequest asks for (or acknowledges/NACKs) the named resources of typeURL.
+	// A nil errDetail means ACK; a non-nil one means NACK and is surfaced to the server.
+	SendRequest(typeURL string, names []string, errDetail error) error
+
+	// RecvResponse blocks for the next response on the stream and normalizes it.
+	RecvResponse() (*discoveryResponse, error)
+
+	// HandleResponse applies resp to assignments and ACKs it, or NACKs it (with
+	// resp.parseErr) if one or more of its resources failed to parse.
+	HandleResponse(resp *discoveryResponse) error
+
+	// Close tears down the underlying stream.
+	Close()
+}
+
+// newAPIClient returns the apiClient for the given wire version ("v2" or "v3") and
+// protocol (delta or State-of-the-World).
+func (c *Client) newAPIClient() (apiClient, error) {
+	if c.delta {
+		return newDeltaClient(c)
+	}
+	switch c.version {
+	case "v3":
+		return newSotwClientV3(c)
+	default:
+		return newSotwClientV2(c)
+	}
+}
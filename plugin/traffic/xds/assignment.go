@@ -0,0 +1,266 @@
+package xds
+
+import (
+	"math/rand"
+	"net"
+	"sort"
+	"sync"
+)
+
+// assignment holds the endpoint data learned via EDS, keyed by cluster name. It is
+// safe for concurrent use. It is deliberately decoupled from the v2/v3 proto wire
+// types so the rest of the package doesn't care which xDS version produced the data.
+type assignment struct {
+	mu  sync.RWMutex
+	cla map[string]*clusterLoadAssignment
+
+	// rand is pluggable so tests can assert distribution without real randomness.
+	// *rand.Rand isn't safe for concurrent use on its own, so every call goes through
+	// randFloat64, which serializes access with randMu - selectIP only holds mu for
+	// reading, so concurrent Select/Select6/SelectLocality calls would otherwise race
+	// on rand's internal state.
+	rand   rng
+	randMu sync.Mutex
+}
+
+// rng is the seam Select uses for weighted random choices, so tests can substitute a
+// deterministic (or biased) source instead of the seeded *rand.Rand newAssignment installs.
+type rng interface {
+	Float64() float64
+}
+
+func newAssignment() *assignment {
+	return &assignment{
+		cla:  make(map[string]*clusterLoadAssignment),
+		rand: rand.New(rand.NewSource(1)),
+	}
+}
+
+// randFloat64 is rand.Float64, serialized so concurrent Select/Select6/SelectLocality
+// calls can't race on the underlying *rand.Rand's state.
+func (a *assignment) randFloat64() float64 {
+	a.randMu.Lock()
+	defer a.randMu.Unlock()
+	return a.rand.Float64()
+}
+
+// claKind distinguishes cluster load assignments populated over EDS from those
+// synthesized locally by dns.go for STRICT_DNS/LOGICAL_DNS clusters, so EDSClusters
+// can build an accurate EDS subscription list (see client.go's Receive).
+type claKind int
+
+const (
+	claKindEDS claKind = iota // the zero value: registered via CDS as an EDS-type cluster
+	claKindDNS                // resolved directly by dns.go, never subscribed to EDS
+)
+
+// clusterLoadAssignment is the version-independent subset of
+// envoy.api.v2.ClusterLoadAssignment / envoy.config.endpoint.v3.ClusterLoadAssignment
+// that Select needs to reproduce Envoy's locality-weighted, priority-failover LB policy.
+type clusterLoadAssignment struct {
+	kind claKind
+
+	// overprovisioningFactor is Policy.overprovisioning_factor, or the Envoy default of
+	// 140 (i.e. 1.4x) if the management server didn't set one.
+	overprovisioningFactor uint32
+	priorities             map[uint32]*priorityLevel
+}
+
+// priorityLevel is every locality at a single Cluster.priority level.
+type priorityLevel struct {
+	localities    []*localityEndpoints
+	healthyWeight uint64 // sum of weight across healthy/unknown endpoints at this level
+	totalWeight   uint64 // sum of weight across every endpoint at this level
+}
+
+// healthyFraction is the fraction (0.0-1.0) of this priority level's capacity that is
+// healthy or unknown, used by Envoy's overprovisioning-factor priority failover math.
+func (pl *priorityLevel) healthyFraction() float64 {
+	if pl.totalWeight == 0 {
+		return 0
+	}
+	return float64(pl.healthyWeight) / float64(pl.totalWeight)
+}
+
+// Locality identifies an envoy.api.v2.core.Locality / envoy.config.core.v3.Locality.
+// It doubles as the key LRS reports load under, so it must be comparable.
+type Locality struct {
+	Region  string
+	Zone    string
+	SubZone string
+}
+
+// localityEndpoints is one LocalityLbEndpoints: a weighted group of endpoints.
+type localityEndpoints struct {
+	locality  Locality
+	weight    uint32 // locality_weight, defaults to 1 if unset; pickLocality never selects weight 0
+	endpoints []weightedEndpoint
+}
+
+// weightedEndpoint is one LbEndpoint.
+type weightedEndpoint struct {
+	ip     net.IP
+	weight uint32 // load_balancing_weight, defaults to 1 if unset
+}
+
+func newClusterLoadAssignment() *clusterLoadAssignment {
+	return &clusterLoadAssignment{overprovisioningFactor: 140, priorities: make(map[uint32]*priorityLevel)}
+}
+
+// SetClusterLoadAssignment records the endpoints known for cluster. A nil cla just
+// registers the cluster name as EDS-type (e.g. so EDSClusters() can ask EDS for it)
+// without endpoints.
+func (a *assignment) SetClusterLoadAssignment(cluster string, cla *clusterLoadAssignment) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if cla == nil {
+		if _, ok := a.cla[cluster]; !ok {
+			a.cla[cluster] = newClusterLoadAssignment()
+		}
+		return
+	}
+	a.cla[cluster] = cla
+}
+
+// EDSClusters returns the names of clusters registered via CDS as EDS-type - the set
+// Receive should (re)subscribe to EDS for. STRICT_DNS/LOGICAL_DNS clusters are resolved
+// directly by dns.go and are never included, even after they've been resolved once.
+func (a *assignment) EDSClusters() []string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	cl := make([]string, 0, len(a.cla))
+	for name, c := range a.cla {
+		if c.kind == claKindEDS {
+			cl = append(cl, name)
+		}
+	}
+	return cl
+}
+
+// RemoveCluster forgets cluster entirely, so Select stops returning its last-known
+// endpoints once it's dropped from CDS.
+func (a *assignment) RemoveCluster(cluster string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.cla, cluster)
+}
+
+// Select returns an IPv4 endpoint for cluster, following Envoy's locality-weighted,
+// priority-failover load balancing policy, or nil if none are available.
+func (a *assignment) Select(cluster string) net.IP { ip, _ := a.selectIP(cluster, false); return ip }
+
+// Select6 is Select, but for IPv6 endpoints.
+func (a *assignment) Select6(cluster string) net.IP { ip, _ := a.selectIP(cluster, true); return ip }
+
+// SelectLocality is Select, but also returns the Locality the chosen endpoint came
+// from, for LRS reporting. The zero Locality is returned alongside a nil IP when
+// nothing is available.
+func (a *assignment) SelectLocality(cluster string) (net.IP, Locality) { return a.selectIP(cluster, false) }
+
+func (a *assignment) selectIP(cluster string, v6 bool) (net.IP, Locality) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	c, ok := a.cla[cluster]
+	if !ok {
+		return nil, Locality{}
+	}
+	pl := c.activePriority()
+	if pl == nil {
+		return nil, Locality{}
+	}
+	// Only localities holding an endpoint of the requested family take part in the
+	// locality pick, so the chosen one always has an endpoint to return.
+	eligible := &priorityLevel{}
+	for _, le := range pl.localities {
+		for _, ep := range le.endpoints {
+			if (ep.ip.To4() == nil) == v6 {
+				eligible.localities = append(eligible.localities, le)
+				break
+			}
+		}
+	}
+	le := a.pickLocality(eligible)
+	if le == nil {
+		return nil, Locality{}
+	}
+	return a.pickEndpoint(le, v6), le.locality
+}
+
+// activePriority implements Envoy's priority failover: use the lowest-numbered
+// priority whose adjusted health (overprovisioning_factor * healthy_fraction) is at
+// least 100%, falling back to higher-numbered (lower priority, worse) levels as health
+// degrades, and to the worst level available if none clear the bar.
+func (c *clusterLoadAssignment) activePriority() *priorityLevel {
+	if len(c.priorities) == 0 {
+		return nil
+	}
+	levels := make([]uint32, 0, len(c.priorities))
+	for p := range c.priorities {
+		levels = append(levels, p)
+	}
+	sort.Slice(levels, func(i, j int) bool { return levels[i] < levels[j] })
+
+	for _, p := range levels {
+		pl := c.priorities[p]
+		if float64(c.overprovisioningFactor)/100.0*pl.healthyFraction() >= 1.0 {
+			return pl
+		}
+	}
+	return c.priorities[levels[len(levels)-1]]
+}
+
+// pickLocality weighted-selects a locality within pl by locality_weight.
+func (a *assignment) pickLocality(pl *priorityLevel) *localityEndpoints {
+	var total uint32
+	for _, le := range pl.localities {
+		total += le.weight
+	}
+	if total == 0 {
+		return nil
+	}
+
+	r := uint32(a.randFloat64() * float64(total))
+	for _, le := range pl.localities {
+		if r < le.weight {
+			return le
+		}
+		r -= le.weight
+	}
+	return pl.localities[len(pl.localities)-1]
+}
+
+// pickEndpoint weighted-selects a healthy endpoint of the requested family within le by
+// load_balancing_weight.
+func (a *assignment) pickEndpoint(le *localityEndpoints, v6 bool) net.IP {
+	candidates := make([]weightedEndpoint, 0, len(le.endpoints))
+	for _, ep := range le.endpoints {
+		isV4 := ep.ip.To4() != nil
+		if isV4 == v6 { // wrong family
+			continue
+		}
+		candidates = append(candidates, ep)
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	var total uint32
+	for _, ep := range candidates {
+		total += ep.weight
+	}
+	if total == 0 {
+		return candidates[0].ip
+	}
+
+	r := uint32(a.randFloat64() * float64(total))
+	for _, ep := range candidates {
+		if r < ep.weight {
+			return ep.ip
+		}
+		r -= ep.weight
+	}
+	return candidates[len(candidates)-1].ip
+}
@@ -0,0 +1,162 @@
+package xds
+
+import (
+	"net"
+	"testing"
+)
+
+// sequenceRNG implements rng by cycling through a fixed sequence of Float64 values, so
+// a test can drive Select's weighted choices deterministically instead of depending on
+// the *rand.Rand that newAssignment installs.
+type sequenceRNG struct {
+	values []float64
+	i      int
+}
+
+func (s *sequenceRNG) Float64() float64 {
+	v := s.values[s.i%len(s.values)]
+	s.i++
+	return v
+}
+
+// evenlySpacedRNG returns n values evenly spaced across [0, 1), for sampling a weighted
+// pick's distribution over many calls.
+func evenlySpacedRNG(n int) *sequenceRNG {
+	values := make([]float64, n)
+	for i := range values {
+		values[i] = float64(i) / float64(n)
+	}
+	return &sequenceRNG{values: values}
+}
+
+func TestActivePriorityFailover(t *testing.T) {
+	cases := []struct {
+		name     string
+		cla      *clusterLoadAssignment
+		wantPrio uint32
+	}{
+		{
+			name: "priority 0 healthy, stays on priority 0",
+			cla: &clusterLoadAssignment{
+				overprovisioningFactor: 140,
+				priorities: map[uint32]*priorityLevel{
+					0: {healthyWeight: 100, totalWeight: 100},
+					1: {healthyWeight: 100, totalWeight: 100},
+				},
+			},
+			wantPrio: 0,
+		},
+		{
+			name: "priority 0 degraded below overprovisioned threshold, fails over to priority 1",
+			cla: &clusterLoadAssignment{
+				overprovisioningFactor: 140,
+				priorities: map[uint32]*priorityLevel{
+					0: {healthyWeight: 50, totalWeight: 100}, // 50% * 1.4 = 70% < 100%
+					1: {healthyWeight: 100, totalWeight: 100},
+				},
+			},
+			wantPrio: 1,
+		},
+		{
+			name: "every priority degraded, falls back to the worst one",
+			cla: &clusterLoadAssignment{
+				overprovisioningFactor: 140,
+				priorities: map[uint32]*priorityLevel{
+					0: {healthyWeight: 10, totalWeight: 100},
+					1: {healthyWeight: 10, totalWeight: 100},
+				},
+			},
+			wantPrio: 1,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := tc.cla.activePriority()
+			want := tc.cla.priorities[tc.wantPrio]
+			if got != want {
+				t.Errorf("activePriority() = %p, want priority %d (%p)", got, tc.wantPrio, want)
+			}
+		})
+	}
+}
+
+func TestPickLocalityDistribution(t *testing.T) {
+	light := &localityEndpoints{locality: Locality{Region: "light"}, weight: 1}
+	heavy := &localityEndpoints{locality: Locality{Region: "heavy"}, weight: 3}
+	pl := &priorityLevel{localities: []*localityEndpoints{light, heavy}}
+
+	const samples = 4000
+	a := &assignment{rand: evenlySpacedRNG(samples)}
+
+	counts := map[string]int{}
+	for i := 0; i < samples; i++ {
+		le := a.pickLocality(pl)
+		if le == nil {
+			t.Fatalf("pickLocality() returned nil on sample %d", i)
+		}
+		counts[le.locality.Region]++
+	}
+
+	// Weights are 1:3, so "heavy" should be picked roughly 3x as often as "light".
+	wantLight, wantHeavy := samples/4, samples*3/4
+	if !within(counts["light"], wantLight, samples/50) {
+		t.Errorf("light locality picked %d times, want ~%d", counts["light"], wantLight)
+	}
+	if !within(counts["heavy"], wantHeavy, samples/50) {
+		t.Errorf("heavy locality picked %d times, want ~%d", counts["heavy"], wantHeavy)
+	}
+}
+
+func TestPickEndpointSkipsWrongFamily(t *testing.T) {
+	v4 := net.ParseIP("10.0.0.1")
+	v6 := net.ParseIP("2001:db8::1")
+	le := &localityEndpoints{
+		endpoints: []weightedEndpoint{
+			{ip: v4, weight: 1},
+			{ip: v6, weight: 1},
+		},
+	}
+	a := &assignment{rand: evenlySpacedRNG(100)}
+
+	for i := 0; i < 50; i++ {
+		if got := a.pickEndpoint(le, false); got.String() != v4.String() {
+			t.Fatalf("pickEndpoint(v6=false) = %s, want %s", got, v4)
+		}
+		if got := a.pickEndpoint(le, true); got.String() != v6.String() {
+			t.Fatalf("pickEndpoint(v6=true) = %s, want %s", got, v6)
+		}
+	}
+}
+
+func TestPickEndpointDistribution(t *testing.T) {
+	a1 := weightedEndpoint{ip: net.ParseIP("10.0.0.1"), weight: 1}
+	a2 := weightedEndpoint{ip: net.ParseIP("10.0.0.2"), weight: 1}
+	a3 := weightedEndpoint{ip: net.ParseIP("10.0.0.3"), weight: 2}
+	le := &localityEndpoints{endpoints: []weightedEndpoint{a1, a2, a3}}
+
+	const samples = 4000
+	a := &assignment{rand: evenlySpacedRNG(samples)}
+
+	counts := map[string]int{}
+	for i := 0; i < samples; i++ {
+		ip := a.pickEndpoint(le, false)
+		counts[ip.String()]++
+	}
+
+	want := samples / 4 // a1 and a2 each get weight 1 of 4 total
+	if !within(counts[a1.ip.String()], want, samples/50) {
+		t.Errorf("%s picked %d times, want ~%d", a1.ip, counts[a1.ip.String()], want)
+	}
+	if !within(counts[a3.ip.String()], want*2, samples/50) {
+		t.Errorf("%s picked %d times, want ~%d", a3.ip, counts[a3.ip.String()], want*2)
+	}
+}
+
+func within(got, want, tolerance int) bool {
+	diff := got - want
+	if diff < 0 {
+		diff = -diff
+	}
+	return diff <= tolerance
+}
@@ -0,0 +1,23 @@
+package xds
+
+import (
+	"math/rand"
+	"time"
+)
+
+const (
+	backoffBase = time.Second
+	backoffMax  = 120 * time.Second
+)
+
+// nextBackoff returns the delay to wait before the (attempt+1)th reconnect attempt,
+// doubling from backoffBase up to backoffMax and adding up to 20% jitter so a
+// management server restart doesn't get hammered by every client reconnecting in lockstep.
+func nextBackoff(attempt int) time.Duration {
+	d := backoffBase << uint(attempt)
+	if d <= 0 || d > backoffMax { // overflow, or past the cap
+		d = backoffMax
+	}
+	jitter := time.Duration(rand.Int63n(int64(d) / 5))
+	return d + jitter
+}
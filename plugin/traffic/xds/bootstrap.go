@@ -0,0 +1,84 @@
+package xds
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// bootstrapEnv is the environment variable xDS clients conventionally read the
+// bootstrap file path from, see
+// https://github.com/grpc/grpc/blob/master/doc/grpc_xds_bootstrap_format.md.
+const bootstrapEnv = "GRPC_XDS_BOOTSTRAP"
+
+// Bootstrap is the subset of the xDS bootstrap document CoreDNS understands: who we
+// are (Node) and how to reach the management server (XDSServers).
+type Bootstrap struct {
+	Node       BootstrapNode        `json:"node"`
+	XDSServers []BootstrapXDSServer `json:"xds_servers"`
+}
+
+// BootstrapNode is the "node" bootstrap field, identifying this client to the
+// management server.
+type BootstrapNode struct {
+	ID       string             `json:"id"`
+	Cluster  string             `json:"cluster"`
+	Locality *BootstrapLocality `json:"locality,omitempty"`
+	Metadata map[string]string  `json:"metadata,omitempty"`
+}
+
+// BootstrapLocality is "node.locality".
+type BootstrapLocality struct {
+	Region  string `json:"region"`
+	Zone    string `json:"zone"`
+	SubZone string `json:"sub_zone"`
+}
+
+// BootstrapXDSServer is one entry of "xds_servers".
+type BootstrapXDSServer struct {
+	ServerURI    string                  `json:"server_uri"`
+	ChannelCreds []BootstrapChannelCreds `json:"channel_creds"`
+}
+
+// BootstrapChannelCreds is one "channel_creds" entry: Type is "insecure", "tls" or
+// "google_default"; Config holds type-specific fields (only "tls" uses any today).
+type BootstrapChannelCreds struct {
+	Type   string             `json:"type"`
+	Config BootstrapTLSConfig `json:"config,omitempty"`
+}
+
+// BootstrapTLSConfig is the "config" object of a "tls" channel_creds entry.
+// CertificateFile/PrivateKeyFile are optional; when both are set, the client presents
+// them to the management server for mTLS.
+type BootstrapTLSConfig struct {
+	CACertificateFile  string `json:"ca_certificate_file,omitempty"`
+	CertificateFile    string `json:"certificate_file,omitempty"`
+	PrivateKeyFile     string `json:"private_key_file,omitempty"`
+	ServerNameOverride string `json:"server_name_override,omitempty"`
+}
+
+// LoadBootstrap reads and parses an xDS bootstrap document from path.
+func LoadBootstrap(path string) (*Bootstrap, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	b := new(Bootstrap)
+	if err := json.Unmarshal(buf, b); err != nil {
+		return nil, fmt.Errorf("parsing bootstrap file %q: %s", path, err)
+	}
+	if len(b.XDSServers) == 0 {
+		return nil, fmt.Errorf("bootstrap file %q declares no xds_servers", path)
+	}
+	return b, nil
+}
+
+// LoadBootstrapFromEnv loads the bootstrap document pointed at by the
+// GRPC_XDS_BOOTSTRAP environment variable. It returns (nil, nil) if the variable isn't set.
+func LoadBootstrapFromEnv() (*Bootstrap, error) {
+	path := os.Getenv(bootstrapEnv)
+	if path == "" {
+		return nil, nil
+	}
+	return LoadBootstrap(path)
+}
@@ -22,37 +22,89 @@ package xds
 
 import (
 	"context"
+	"fmt"
 	"net"
+	"sync"
 	"time"
 
 	clog "github.com/coredns/coredns/plugin/pkg/log"
 
-	xdspb "github.com/envoyproxy/go-control-plane/envoy/api/v2"
 	corepb "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
-	adsgrpc "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v2"
-	"github.com/golang/protobuf/ptypes"
+	corepb3 "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	structpb "github.com/golang/protobuf/ptypes/struct"
 	"google.golang.org/grpc"
 )
 
 var log = clog.NewWithPlugin("traffic: xds")
 
-const (
-	cdsURL = "type.googleapis.com/envoy.api.v2.Cluster"
-	edsURL = "type.googleapis.com/envoy.api.v2.ClusterLoadAssignment"
-)
+const userAgentName = "CoreDNS"
 
-type adsStream adsgrpc.AggregatedDiscoveryService_StreamAggregatedResourcesClient
+// userAgentVersion is reported to the management server in Node.user_agent_version.
+// It's not wired to CoreDNS's own version string since this package doesn't import
+// coremain (to avoid a dependency cycle); bump it by hand when the xDS client
+// behavior changes in a way the management server might care about.
+const userAgentVersion = "1.0.0"
 
+// Client talks to an xDS management server over ADS and keeps Select()able endpoint
+// assignments up to date. The wire version (v2/v3) and protocol (SotW/delta) are
+// pluggable via apiClient; everything above that layer is version-agnostic.
 type Client struct {
 	cc          *grpc.ClientConn
 	ctx         context.Context
-	assignments assignment
-	node        *corepb.Node
 	cancel      context.CancelFunc
 	stop        chan struct{}
+	assignments *assignment
+
+	// node identifies this client to the management server. Both representations are
+	// kept around so the v2 and v3 transports can each use the one they need.
+	node  *corepb.Node
+	node3 *corepb3.Node
+
+	version string // "v2" (default) or "v3"
+	delta   bool   // use Delta/Incremental ADS instead of State-of-the-World
+
+	versions      *versionTracker
+	deltaVersions *resourceVersions // per-resource versions for delta mode; survives reconnects
+	api           apiClient
+
+	lrsStats *loadStats
+
+	bootstrap *Bootstrap
+
+	statusMu sync.RWMutex
+	status   Status
+
+	dnsMu     sync.Mutex
+	dnsCancel map[string]context.CancelFunc // cluster name -> cancel for its watchDNSCluster goroutine
+}
+
+// Bootstrap returns the Bootstrap configuration this client was created from, or nil
+// if it was created with New instead of NewFromBootstrap.
+func (c *Client) Bootstrap() *Bootstrap { return c.bootstrap }
+
+// Status reports the current health of the ADS stream, for plugins (or health checks)
+// that want to surface xDS connectivity.
+type Status struct {
+	Connected bool  // true while the ADS stream is up and receiving responses
+	Attempt   int   // number of reconnect attempts since the last successful connection
+	LastError error // the error that caused the most recent disconnect, if any
+}
+
+// Status returns a snapshot of the client's current connection state.
+func (c *Client) Status() Status {
+	c.statusMu.RLock()
+	defer c.statusMu.RUnlock()
+	return c.status
+}
+
+func (c *Client) setStatus(s Status) {
+	c.statusMu.Lock()
+	c.status = s
+	c.statusMu.Unlock()
 }
 
 // New returns a new client that's dialed to addr using node as the local identifier.
+// It speaks v2 State-of-the-World ADS by default; see SetVersion and SetDelta.
 func New(addr, node string) (*Client, error) {
 	// todo credentials!
 	opts := []grpc.DialOption{grpc.WithInsecure()}
@@ -60,102 +112,302 @@ func New(addr, node string) (*Client, error) {
 	if err != nil {
 		return nil, err
 	}
-	c := &Client{cc: cc, node: &corepb.Node{Id: "test-id"}} // do more with this node data? Hostname port??
-	c.assignments = assignment{cla: make(map[string]*xdspb.ClusterLoadAssignment)}
+	c := &Client{
+		cc:            cc,
+		node:          &corepb.Node{Id: node},
+		node3:         &corepb3.Node{Id: node},
+		version:       "v2",
+		assignments:   newAssignment(),
+		versions:      newVersionTracker(),
+		deltaVersions: newResourceVersions(),
+		lrsStats:      newLoadStats(),
+		dnsCancel:     make(map[string]context.CancelFunc),
+	}
 	c.ctx, c.cancel = context.WithCancel(context.Background())
 
 	return c, nil
 }
 
-func (c *Client) Close() { c.cancel(); c.cc.Close() }
+// NewFromBootstrap returns a new client configured per an xDS bootstrap document: node
+// identity (including locality and metadata) and channel credentials for the first
+// xds_servers entry. See LoadBootstrap and LoadBootstrapFromEnv.
+func NewFromBootstrap(b *Bootstrap) (*Client, error) {
+	if len(b.XDSServers) == 0 {
+		return nil, fmt.Errorf("bootstrap declares no xds_servers")
+	}
+	server := b.XDSServers[0]
 
-func (c *Client) Run() (adsgrpc.AggregatedDiscoveryService_StreamAggregatedResourcesClient, error) {
-	cli := adsgrpc.NewAggregatedDiscoveryServiceClient(c.cc)
-	stream, err := cli.StreamAggregatedResources(c.ctx)
+	opt, err := dialOptionsFromServer(server)
 	if err != nil {
 		return nil, err
 	}
-	return stream, nil
+	cc, err := grpc.Dial(server.ServerURI, opt)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		cc:            cc,
+		node:          nodeFromBootstrap(b.Node),
+		node3:         node3FromBootstrap(b.Node),
+		version:       "v2",
+		assignments:   newAssignment(),
+		versions:      newVersionTracker(),
+		deltaVersions: newResourceVersions(),
+		lrsStats:      newLoadStats(),
+		bootstrap:     b,
+		dnsCancel:     make(map[string]context.CancelFunc),
+	}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+
+	return c, nil
+}
+
+// nodeFromBootstrap builds the v2 Node the management server sees from a bootstrap
+// "node" section.
+func nodeFromBootstrap(n BootstrapNode) *corepb.Node {
+	node := &corepb.Node{
+		Id:            n.ID,
+		Cluster:       n.Cluster,
+		UserAgentName: userAgentName,
+	}
+	if n.Locality != nil {
+		node.Locality = &corepb.Locality{Region: n.Locality.Region, Zone: n.Locality.Zone, SubZone: n.Locality.SubZone}
+	}
+	if len(n.Metadata) > 0 {
+		node.Metadata = metadataStruct(n.Metadata)
+	}
+	node.UserAgentVersionType = &corepb.Node_UserAgentVersion{UserAgentVersion: userAgentVersion}
+	return node
+}
+
+// node3FromBootstrap is nodeFromBootstrap for the v3 Node type.
+func node3FromBootstrap(n BootstrapNode) *corepb3.Node {
+	node := &corepb3.Node{
+		Id:            n.ID,
+		Cluster:       n.Cluster,
+		UserAgentName: userAgentName,
+	}
+	if n.Locality != nil {
+		node.Locality = &corepb3.Locality{Region: n.Locality.Region, Zone: n.Locality.Zone, SubZone: n.Locality.SubZone}
+	}
+	if len(n.Metadata) > 0 {
+		node.Metadata = metadataStruct(n.Metadata)
+	}
+	node.UserAgentVersionType = &corepb3.Node_UserAgentVersion{UserAgentVersion: userAgentVersion}
+	return node
 }
 
-func (c *Client) ClusterDiscovery(stream adsStream, version, nonce string, clusters []string) error {
-	req := &xdspb.DiscoveryRequest{
-		Node:          c.node,
-		TypeUrl:       cdsURL,
-		ResourceNames: clusters, // empty for all
-		VersionInfo:   version,
-		ResponseNonce: nonce,
+// metadataStruct turns a flat string map into the google.protobuf.Struct Node.metadata
+// expects.
+func metadataStruct(m map[string]string) *structpb.Struct {
+	fields := make(map[string]*structpb.Value, len(m))
+	for k, v := range m {
+		fields[k] = &structpb.Value{Kind: &structpb.Value_StringValue{StringValue: v}}
 	}
-	return stream.Send(req)
+	return &structpb.Struct{Fields: fields}
 }
 
-func (c *Client) EndpointDiscovery(stream adsStream, version, nonce string, clusters []string) error {
-	req := &xdspb.DiscoveryRequest{
-		Node:          c.node,
-		TypeUrl:       edsURL,
-		ResourceNames: clusters,
-		VersionInfo:   version,
-		ResponseNonce: nonce,
+// SetVersion selects the xDS wire version to speak: "v2" (default) or "v3".
+func (c *Client) SetVersion(version string) { c.version = version }
+
+// SetDelta selects whether to use the Delta/Incremental ADS protocol instead of
+// State-of-the-World.
+func (c *Client) SetDelta(delta bool) { c.delta = delta }
+
+func (c *Client) Close() { c.cancel(); c.cc.Close() }
+
+// Run dials the ADS stream using the configured wire version and protocol.
+func (c *Client) Run() error {
+	api, err := c.newAPIClient()
+	if err != nil {
+		return err
+	}
+	if err := api.Run(c.ctx); err != nil {
+		return err
+	}
+	c.api = api
+	return nil
+}
+
+// Connect drives the ADS stream until ctx is cancelled, reconnecting with capped
+// exponential backoff whenever the stream breaks. Each reconnect resends the last
+// version/nonce the client accepted, so the management server can resume correctly.
+func (c *Client) Connect() {
+	attempt := 0
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		default:
+		}
+
+		if err := c.Run(); err != nil {
+			c.setStatus(Status{Connected: false, Attempt: attempt, LastError: err})
+			log.Warningf("Failed to open ADS stream: %s", err)
+		} else {
+			c.setStatus(Status{Connected: true})
+			attempt = 0
+
+			err := c.Receive()
+
+			c.api.Close()
+			c.setStatus(Status{Connected: false, Attempt: attempt + 1, LastError: err})
+			log.Warningf("ADS stream closed, reconnecting: %s", err)
+		}
+
+		attempt++
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-time.After(nextBackoff(attempt - 1)):
+		}
 	}
-	return stream.Send(req)
 }
 
-func (c *Client) Receive(stream adsStream) error {
+// Receive drives the ADS stream: it requests clusters, and for every CDS update it
+// turns around and asks for the EDS resources backing those clusters.
+func (c *Client) Receive() error {
+	if err := c.api.SendRequest(c.cdsTypeURL(), nil, nil); err != nil {
+		return err
+	}
+
 	for {
-		resp, err := stream.Recv()
+		resp, err := c.api.RecvResponse()
 		if err != nil {
-			log.Warningf("Trouble receiving from the gRPC connection: %s", err)
-			time.Sleep(10 * time.Second) // better.
+			return err
 		}
 
-		switch resp.GetTypeUrl() {
-		case cdsURL:
-			for _, r := range resp.GetResources() {
-				var any ptypes.DynamicAny
-				if err := ptypes.UnmarshalAny(r, &any); err != nil {
-					continue
-				}
-				cluster, ok := any.Message.(*xdspb.Cluster)
-				if !ok {
-					continue
-				}
-				c.assignments.SetClusterLoadAssignment(cluster.GetName(), nil)
-			}
-			log.Debugf("Cluster discovery processed with %d resources", len(resp.GetResources()))
-			// ack the CDS proto, with we we've got. (empty version would be NACK)
-			if err := c.ClusterDiscovery(stream, resp.GetVersionInfo(), resp.GetNonce(), c.assignments.Clusters()); err != nil {
-				log.Warningf("Failed to acknowledge cluster discovery: %s", err)
-			}
-			// need to figure out how to handle the versions and nounces exactly.
+		if err := c.api.HandleResponse(resp); err != nil {
+			log.Warningf("Failed to handle %s response: %s", resp.typeURL, err)
+			continue
+		}
+		if resp.parseErr != nil {
+			continue // NACKed; nothing more to do until the server sends a fix
+		}
 
-			// now kick off discovery for endpoints
-			if err := c.EndpointDiscovery(stream, "", "", c.assignments.Clusters()); err != nil {
+		switch resp.typeURL {
+		case clusterTypeURLv2, clusterTypeURLv3:
+			log.Debugf("Cluster discovery processed with %d resources", len(resp.clusters))
+			if err := c.api.SendRequest(c.edsTypeURL(), c.assignments.EDSClusters(), nil); err != nil {
 				log.Warningf("Failed to perform endpoint discovery: %s", err)
 			}
+		case endpointTypeURLv2, endpointTypeURLv3:
+			log.Debugf("Endpoint discovery processed with %d resources", len(resp.assignments))
+		default:
+			log.Warningf("Unknown response URL for discovery: %q", resp.typeURL)
+		}
+	}
+}
 
-		case edsURL:
-			for _, r := range resp.GetResources() {
-				var any ptypes.DynamicAny
-				if err := ptypes.UnmarshalAny(r, &any); err != nil {
-					log.Debugf("Failed to unmarshal endpoint discovery: %s", err)
-					continue
-				}
-				cla, ok := any.Message.(*xdspb.ClusterLoadAssignment)
-				if !ok {
-					log.Debugf("Unexpected resource type: %T in endpoint discovery", any.Message)
-					continue
-				}
-				c.assignments.SetClusterLoadAssignment(cla.GetClusterName(), cla)
-				// ack the bloody thing
-			}
-			log.Debugf("Endpoint discovery processed with %d resources", len(resp.GetResources()))
+// applyResponse records the version/nonce for resp's TypeURL and merges its contents
+// into assignments. Shared by every apiClient implementation.
+func (c *Client) applyResponse(resp *discoveryResponse) error {
+	c.versions.update(resp.typeURL, resp.version, resp.nonce)
+
+	switch resp.typeURL {
+	case clusterTypeURLv2, clusterTypeURLv3:
+		c.applyClusters(resp.clusters)
+	}
+	for name, cla := range resp.assignments {
+		c.assignments.SetClusterLoadAssignment(name, cla)
+	}
+	// Delta explicitly names removed resources - whether CDS or EDS - so a DNS-type
+	// cluster dropped from CDS stops being refreshed as soon as it's gone, rather than
+	// waiting for the next full SotW CDS snapshot (see applyClusters).
+	for _, name := range resp.removed {
+		c.stopDNSWatch(name)
+	}
+	return nil
+}
 
+// applyClusters registers every EDS-type cluster (so Receive's next request asks EDS
+// for it) and (re)starts DNS watchers for STRICT_DNS/LOGICAL_DNS clusters. In SotW
+// mode, clusters is always the complete current cluster list, so it also stops DNS
+// watchers for clusters that dropped out of it; in delta mode, cleanup instead happens
+// via resp.removed in applyResponse, since a delta CDS response only ever carries what
+// changed.
+func (c *Client) applyClusters(clusters []cluster) {
+	seen := make(map[string]bool, len(clusters))
+	for _, cl := range clusters {
+		seen[cl.name] = true
+		switch cl.typ {
+		case clusterEDS:
+			if !cl.edsViaADS {
+				log.Warningf("Cluster %q names an eds_config we don't support, skipping", cl.name)
+				continue
+			}
+			c.assignments.SetClusterLoadAssignment(cl.name, nil)
+		case clusterStrictDNS, clusterLogicalDNS:
+			c.startDNSWatch(cl)
 		default:
-			log.Warningf("Unknown response URL for discovery: %q", resp.GetTypeUrl())
-			continue
+			log.Warningf("Cluster %q has an unsupported discovery type, skipping", cl.name)
+		}
+	}
+
+	if c.delta {
+		return
+	}
+	c.dnsMu.Lock()
+	defer c.dnsMu.Unlock()
+	for name, cancel := range c.dnsCancel {
+		if !seen[name] {
+			cancel()
+			delete(c.dnsCancel, name)
+			c.assignments.RemoveCluster(name)
 		}
 	}
 }
 
-// Select is a small wrapper. bla bla, keeps assigmens private.
+// startDNSWatch (re)starts the background resolver for a STRICT_DNS/LOGICAL_DNS
+// cluster, replacing any watcher already running for the same cluster name so a CDS
+// update to its hostnames or refresh rate takes effect.
+func (c *Client) startDNSWatch(cl cluster) {
+	c.dnsMu.Lock()
+	defer c.dnsMu.Unlock()
+
+	if cancel, ok := c.dnsCancel[cl.name]; ok {
+		cancel()
+	}
+	ctx, cancel := context.WithCancel(c.ctx)
+	c.dnsCancel[cl.name] = cancel
+	go c.watchDNSCluster(ctx, cl)
+}
+
+// stopDNSWatch cancels and forgets the DNS watcher for name, if one is running. A
+// no-op for clusters that were never STRICT_DNS/LOGICAL_DNS, or that were already
+// stopped.
+func (c *Client) stopDNSWatch(name string) {
+	c.dnsMu.Lock()
+	defer c.dnsMu.Unlock()
+
+	if cancel, ok := c.dnsCancel[name]; ok {
+		cancel()
+		delete(c.dnsCancel, name)
+	}
+}
+
+func (c *Client) cdsTypeURL() string {
+	if c.version == "v3" || c.delta { // the delta client only speaks v3
+
+		return clusterTypeURLv3
+	}
+	return clusterTypeURLv2
+}
+
+func (c *Client) edsTypeURL() string {
+	if c.version == "v3" || c.delta {
+		return endpointTypeURLv3
+	}
+	return endpointTypeURLv2
+}
+
+// Select is a small wrapper that keeps assignments private. It returns an IPv4 address.
 func (c *Client) Select(cluster string) net.IP { return c.assignments.Select(cluster) }
+
+// Select6 is Select, but for IPv6 addresses.
+func (c *Client) Select6(cluster string) net.IP { return c.assignments.Select6(cluster) }
+
+// SelectLocality is Select, but also reports the Locality the endpoint came from, so
+// callers can attribute LRS load reports correctly.
+func (c *Client) SelectLocality(cluster string) (net.IP, Locality) { return c.assignments.SelectLocality(cluster) }
@@ -0,0 +1,89 @@
+package xds
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/google"
+)
+
+// dialOptionsFromChannelCreds turns a bootstrap "channel_creds" entry into the
+// grpc.DialOption needed to establish that kind of channel.
+func dialOptionsFromChannelCreds(cc BootstrapChannelCreds) (grpc.DialOption, error) {
+	switch cc.Type {
+	case "", "insecure":
+		return grpc.WithInsecure(), nil
+	case "tls":
+		creds, err := tlsCredentialsFromConfig(cc.Config)
+		if err != nil {
+			return nil, fmt.Errorf("loading tls channel_creds: %s", err)
+		}
+		return grpc.WithTransportCredentials(creds), nil
+	case "google_default":
+		return grpc.WithCredentialsBundle(google.NewDefaultCredentials()), nil
+	}
+	return nil, fmt.Errorf("unsupported channel_creds type %q", cc.Type)
+}
+
+// tlsCredentialsFromConfig builds the transport credentials for a "tls" channel_creds
+// entry: always verifies the management server against ca_certificate_file (or the
+// system roots, if unset); additionally presents certificate_file/private_key_file as
+// a client certificate when both are set, for mutual TLS.
+func tlsCredentialsFromConfig(cfg BootstrapTLSConfig) (credentials.TransportCredentials, error) {
+	if cfg.CertificateFile == "" && cfg.PrivateKeyFile == "" {
+		return credentials.NewClientTLSFromFile(cfg.CACertificateFile, cfg.ServerNameOverride)
+	}
+
+	cert, err := tls.LoadX509KeyPair(cfg.CertificateFile, cfg.PrivateKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("loading client certificate: %s", err)
+	}
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ServerName:   cfg.ServerNameOverride,
+	}
+	if cfg.CACertificateFile != "" {
+		pool, err := certPoolFromFile(cfg.CACertificateFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return credentials.NewTLS(tlsConfig), nil
+}
+
+// certPoolFromFile reads a PEM-encoded CA bundle from path into a cert pool.
+func certPoolFromFile(path string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading ca_certificate_file: %s", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in ca_certificate_file %q", path)
+	}
+	return pool, nil
+}
+
+// dialOptionsFromServer picks the first channel_creds entry this client knows how to
+// use, as recommended by the bootstrap spec (clients should use the first supported
+// entry and ignore the rest).
+func dialOptionsFromServer(s BootstrapXDSServer) (grpc.DialOption, error) {
+	if len(s.ChannelCreds) == 0 {
+		return grpc.WithInsecure(), nil
+	}
+	var lastErr error
+	for _, cc := range s.ChannelCreds {
+		opt, err := dialOptionsFromChannelCreds(cc)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return opt, nil
+	}
+	return nil, lastErr
+}
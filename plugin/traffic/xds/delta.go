@@ -0,0 +1,203 @@
+package xds
+
+import (
+	"context"
+
+	clusterpb "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	endpointpb "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+	adsgrpc "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	"github.com/golang/protobuf/ptypes"
+)
+
+// resourceVersions tracks, for a single TypeURL, the version the client last accepted
+// for each resource name. Delta responses only ever carry what changed, so unlike SotW
+// the client - not the server - is the source of truth for "what do I already have".
+type resourceVersions struct {
+	byType map[string]map[string]string // typeURL -> resource name -> version
+}
+
+func newResourceVersions() *resourceVersions {
+	return &resourceVersions{byType: make(map[string]map[string]string)}
+}
+
+func (r *resourceVersions) set(typeURL, name, version string) {
+	m, ok := r.byType[typeURL]
+	if !ok {
+		m = make(map[string]string)
+		r.byType[typeURL] = m
+	}
+	m[name] = version
+}
+
+func (r *resourceVersions) remove(typeURL, name string) {
+	delete(r.byType[typeURL], name)
+}
+
+// snapshot returns a copy of the name->version map known for typeURL, suitable for
+// InitialResourceVersions, or nil if nothing is known yet.
+func (r *resourceVersions) snapshot(typeURL string) map[string]string {
+	m := r.byType[typeURL]
+	if len(m) == 0 {
+		return nil
+	}
+	out := make(map[string]string, len(m))
+	for name, version := range m {
+		out[name] = version
+	}
+	return out
+}
+
+// deltaClient implements apiClient for the Delta/Incremental ADS protocol (v3 wire
+// types; the v2 delta surface is structurally identical but unused by CoreDNS's
+// upstream management servers today, so we only wire v3 here). Per-resource versions
+// live on Client (c.deltaVersions) so they survive a reconnect - only initialSent,
+// which tracks whether this particular stream has already sent its initial subscribe
+// for a TypeURL, is reset each time a deltaClient is built.
+type deltaClient struct {
+	c           *Client
+	stream      adsgrpc.AggregatedDiscoveryService_DeltaAggregatedResourcesClient
+	initialSent map[string]bool
+}
+
+func newDeltaClient(c *Client) (apiClient, error) {
+	return &deltaClient{c: c, initialSent: make(map[string]bool)}, nil
+}
+
+func (d *deltaClient) Run(ctx context.Context) error {
+	cli := adsgrpc.NewAggregatedDiscoveryServiceClient(d.c.cc)
+	stream, err := cli.DeltaAggregatedResources(ctx)
+	if err != nil {
+		return err
+	}
+	d.stream = stream
+	return nil
+}
+
+func (d *deltaClient) Close() {
+	if d.stream != nil {
+		d.stream.CloseSend()
+	}
+}
+
+// SendRequest sends a DeltaDiscoveryRequest. names is used as the initial/updated
+// subscription set (resource_names_subscribe); unsubscriptions are driven separately
+// by Client as resources disappear from CDS. The first request for a given typeURL on
+// this stream also carries InitialResourceVersions, so the server can send us a diff
+// against what we already have instead of the whole resource set again.
+func (d *deltaClient) SendRequest(typeURL string, names []string, errDetail error) error {
+	req := &adsgrpc.DeltaDiscoveryRequest{
+		Node:                   d.c.node3,
+		TypeUrl:                typeURL,
+		ResourceNamesSubscribe: names,
+		ResponseNonce:          d.c.versions.nonce(typeURL),
+	}
+	if !d.initialSent[typeURL] {
+		req.InitialResourceVersions = d.c.deltaVersions.snapshot(typeURL)
+		d.initialSent[typeURL] = true
+	}
+	if errDetail != nil {
+		req.ErrorDetail = statusFromErr(errDetail)
+	}
+	return d.stream.Send(req)
+}
+
+// unsubscribe drops names from typeURL's subscription and forgets their versions.
+func (d *deltaClient) unsubscribe(typeURL string, names []string) error {
+	for _, n := range names {
+		d.c.deltaVersions.remove(typeURL, n)
+	}
+	return d.stream.Send(&adsgrpc.DeltaDiscoveryRequest{
+		Node:                     d.c.node3,
+		TypeUrl:                  typeURL,
+		ResourceNamesUnsubscribe: names,
+		ResponseNonce:            d.c.versions.nonce(typeURL),
+	})
+}
+
+func (d *deltaClient) RecvResponse() (*discoveryResponse, error) {
+	resp, err := d.stream.Recv()
+	if err != nil {
+		return nil, err
+	}
+
+	out := &discoveryResponse{
+		typeURL: resp.GetTypeUrl(),
+		nonce:   resp.GetNonce(),
+		removed: resp.GetRemovedResources(),
+	}
+
+	// Versions are only recorded once the whole response parsed, since a NACKed
+	// response is not applied.
+	accepted := make(map[string]string)
+	switch resp.GetTypeUrl() {
+	case clusterTypeURLv3:
+		for _, r := range resp.GetResources() {
+			var any ptypes.DynamicAny
+			if err := ptypes.UnmarshalAny(r.GetResource(), &any); err != nil {
+				out.parseErr = err
+				continue
+			}
+			cl, ok := any.Message.(*clusterpb.Cluster)
+			if !ok {
+				continue
+			}
+			out.clusters = append(out.clusters, clusterFromV3(cl))
+			accepted[r.GetName()] = r.GetVersion()
+		}
+	case endpointTypeURLv3:
+		out.assignments = make(map[string]*clusterLoadAssignment)
+		for _, r := range resp.GetResources() {
+			var any ptypes.DynamicAny
+			if err := ptypes.UnmarshalAny(r.GetResource(), &any); err != nil {
+				out.parseErr = err
+				continue
+			}
+			cla, ok := any.Message.(*endpointpb.ClusterLoadAssignment)
+			if !ok {
+				continue
+			}
+			out.assignments[cla.GetClusterName()] = claFromV3(cla)
+			accepted[r.GetName()] = r.GetVersion()
+		}
+	}
+	if out.parseErr == nil {
+		for n, v := range accepted {
+			d.c.deltaVersions.set(resp.GetTypeUrl(), n, v)
+		}
+		for _, n := range out.removed {
+			d.c.deltaVersions.remove(resp.GetTypeUrl(), n)
+		}
+	}
+	return out, nil
+}
+
+func (d *deltaClient) HandleResponse(resp *discoveryResponse) error {
+	if resp.parseErr != nil {
+		log.Warningf("NACKing %s: %s", resp.typeURL, resp.parseErr)
+		d.c.versions.setNonce(resp.typeURL, resp.nonce)
+		return d.SendRequest(resp.typeURL, nil, resp.parseErr)
+	}
+
+	if err := d.c.applyResponse(resp); err != nil {
+		return err
+	}
+	for _, n := range resp.removed {
+		if resp.typeURL == clusterTypeURLv3 {
+			// The cluster itself is gone from CDS: forget it entirely, so Select stops
+			// returning its last-known endpoints and it drops out of EDSClusters.
+			d.c.assignments.RemoveCluster(n)
+		} else {
+			// Only its endpoints were withdrawn over EDS; it's still a registered
+			// EDS-type cluster per CDS, so keep it around with no endpoints.
+			d.c.assignments.SetClusterLoadAssignment(n, &clusterLoadAssignment{})
+		}
+	}
+	if resp.typeURL == clusterTypeURLv3 && len(resp.removed) > 0 {
+		if err := d.unsubscribe(endpointTypeURLv3, resp.removed); err != nil {
+			log.Warningf("Failed to unsubscribe stale EDS resources: %s", err)
+		}
+	}
+
+	d.c.versions.setNonce(resp.typeURL, resp.nonce)
+	return d.SendRequest(resp.typeURL, nil, nil)
+}
@@ -0,0 +1,87 @@
+package xds
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	durationpb "github.com/golang/protobuf/ptypes/duration"
+)
+
+// defaultDNSRefreshRate is used for STRICT_DNS/LOGICAL_DNS clusters that don't set
+// dns_refresh_rate, matching Envoy's own default.
+const defaultDNSRefreshRate = 5 * time.Second
+
+// dnsRefreshRateOf converts a Cluster.dns_refresh_rate Duration, falling back to
+// defaultDNSRefreshRate if it's unset or invalid.
+func dnsRefreshRateOf(d *durationpb.Duration) time.Duration {
+	if d == nil {
+		return defaultDNSRefreshRate
+	}
+	rate, err := ptypes.Duration(d)
+	if err != nil || rate <= 0 {
+		return defaultDNSRefreshRate
+	}
+	return rate
+}
+
+// dnsResolver keeps a single STRICT_DNS/LOGICAL_DNS cluster's assignment up to date by
+// periodically re-resolving its hostnames with net.Resolver, instead of over EDS.
+type dnsResolver struct {
+	cluster   string
+	hostnames []string
+	res       *net.Resolver
+}
+
+// watchDNSCluster resolves cl's hostnames immediately and then every cl.dnsRefreshRate,
+// feeding the result into assignments as a single-priority, single-locality
+// clusterLoadAssignment, until ctx is done. Client restarts the watcher (see
+// startDNSWatch) whenever CDS sends an updated definition for cl.
+func (c *Client) watchDNSCluster(ctx context.Context, cl cluster) {
+	r := &dnsResolver{cluster: cl.name, hostnames: cl.dnsHostnames, res: net.DefaultResolver}
+
+	r.resolve(ctx, c)
+	ticker := time.NewTicker(cl.dnsRefreshRate)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.resolve(ctx, c)
+		}
+	}
+}
+
+// resolve looks up r's hostnames and replaces its cluster's assignment with the
+// result. If every lookup fails the previous assignment is left in place; if only some
+// fail, the assignment is replaced by the addresses that did resolve.
+func (r *dnsResolver) resolve(ctx context.Context, c *Client) {
+	var endpoints []weightedEndpoint
+	for _, host := range r.hostnames {
+		ips, err := r.res.LookupIP(ctx, "ip", host)
+		if err != nil {
+			log.Warningf("Failed to resolve %q for cluster %q: %s", host, r.cluster, err)
+			continue
+		}
+		for _, ip := range ips {
+			endpoints = append(endpoints, weightedEndpoint{ip: ip, weight: 1})
+		}
+	}
+	if len(endpoints) == 0 {
+		return
+	}
+
+	cla := newClusterLoadAssignment()
+	cla.kind = claKindDNS
+	cla.priorities[0] = &priorityLevel{
+		localities: []*localityEndpoints{{weight: 1, endpoints: endpoints}},
+		// A DNS-resolved cluster has no health checking, so its endpoints count as
+		// both the total and healthy weight.
+		healthyWeight: uint64(len(endpoints)),
+		totalWeight:   uint64(len(endpoints)),
+	}
+	c.assignments.SetClusterLoadAssignment(r.cluster, cla)
+}
@@ -0,0 +1,14 @@
+package xds
+
+import (
+	rpcpb "google.golang.org/genproto/googleapis/rpc/status"
+)
+
+// statusFromErr wraps err as the google.rpc.Status carried in a NACK
+// (DiscoveryRequest.ErrorDetail / DeltaDiscoveryRequest.ErrorDetail).
+func statusFromErr(err error) *rpcpb.Status {
+	if err == nil {
+		return nil
+	}
+	return &rpcpb.Status{Message: err.Error()}
+}
@@ -0,0 +1,171 @@
+package xds
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	corepb "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	endpointpb "github.com/envoyproxy/go-control-plane/envoy/api/v2/endpoint"
+	lrsgrpc "github.com/envoyproxy/go-control-plane/envoy/service/load_stats/v2"
+	"github.com/golang/protobuf/ptypes"
+)
+
+// loadStats accumulates the DNS-level counters LRS reports back to the management
+// server, keyed by cluster and then by the locality the answer pointed at.
+type loadStats struct {
+	mu       sync.Mutex
+	clusters map[string]map[Locality]*localityCounters
+}
+
+type localityCounters struct {
+	success uint64
+	errors  uint64
+}
+
+func newLoadStats() *loadStats {
+	return &loadStats{clusters: make(map[string]map[Locality]*localityCounters)}
+}
+
+// Record counts one DNS answer for cluster/locality, as a success (an address was
+// returned) or an error (NXDOMAIN/SERVFAIL because no healthy endpoint was found).
+func (l *loadStats) Record(cluster string, locality Locality, success bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	byLocality, ok := l.clusters[cluster]
+	if !ok {
+		byLocality = make(map[Locality]*localityCounters)
+		l.clusters[cluster] = byLocality
+	}
+	c, ok := byLocality[locality]
+	if !ok {
+		c = &localityCounters{}
+		byLocality[locality] = c
+	}
+	if success {
+		c.success++
+	} else {
+		c.errors++
+	}
+}
+
+// drain returns every cluster's counters and resets them, ready for the next
+// LoadStatsRequest interval.
+func (l *loadStats) drain() map[string]map[Locality]*localityCounters {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	out := l.clusters
+	l.clusters = make(map[string]map[Locality]*localityCounters)
+	return out
+}
+
+// RunLRSWithRetry drives RunLRS until the client is closed, reconnecting with the same
+// capped exponential backoff Connect uses for the ADS stream whenever the LRS stream
+// breaks.
+func (c *Client) RunLRSWithRetry() {
+	attempt := 0
+	for {
+		select {
+		case <-c.ctx.Done():
+			return
+		default:
+		}
+
+		if err := c.RunLRS(c.ctx); err != nil {
+			log.Warningf("LRS stream closed, reconnecting: %s", err)
+		}
+
+		attempt++
+		select {
+		case <-c.ctx.Done():
+			return
+		case <-time.After(nextBackoff(attempt - 1)):
+		}
+	}
+}
+
+// RunLRS opens the LRS (Load Reporting Service) stream alongside the ADS stream and
+// periodically reports the DNS-level counters Traffic.ServeDNS has been recording via
+// Client.RecordOutcome. It runs until ctx is cancelled or the stream errors.
+func (c *Client) RunLRS(ctx context.Context) error {
+	cli := lrsgrpc.NewLoadReportingServiceClient(c.cc)
+	stream, err := cli.StreamLoadStats(ctx)
+	if err != nil {
+		return err
+	}
+	defer stream.CloseSend()
+
+	if err := stream.Send(&lrsgrpc.LoadStatsRequest{Node: c.node}); err != nil {
+		return err
+	}
+	resp, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+
+	interval, err := ptypes.Duration(resp.GetLoadReportingInterval())
+	if err != nil || interval <= 0 {
+		interval = 10 * time.Second
+	}
+	sendAll := resp.GetSendAllClusters()
+	clusters := resp.GetClusters()
+	if resp.GetReportEndpointGranularity() {
+		log.Warning("Management server asked for per-endpoint LRS granularity; reporting per-locality only")
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			req := c.buildLoadStatsRequest(sendAll, clusters)
+			if err := stream.Send(req); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// buildLoadStatsRequest drains the accumulated counters into a LoadStatsRequest,
+// restricted to clusters (unless sendAll, in which case every cluster with counters
+// is reported).
+func (c *Client) buildLoadStatsRequest(sendAll bool, clusters []string) *lrsgrpc.LoadStatsRequest {
+	wanted := make(map[string]bool, len(clusters))
+	for _, cl := range clusters {
+		wanted[cl] = true
+	}
+
+	req := &lrsgrpc.LoadStatsRequest{Node: c.node}
+	for cluster, byLocality := range c.lrsStats.drain() {
+		if !sendAll && !wanted[cluster] {
+			continue
+		}
+		cs := &endpointpb.ClusterStats{ClusterName: cluster}
+		for locality, counters := range byLocality {
+			cs.UpstreamLocalityStats = append(cs.UpstreamLocalityStats, &endpointpb.UpstreamLocalityStats{
+				Locality:                localityToPB(locality),
+				TotalRequestsInProgress: 0, // DNS lookups aren't long-lived requests
+				TotalSuccessfulRequests: counters.success,
+				TotalErrorRequests:      counters.errors,
+			})
+		}
+		req.ClusterStats = append(req.ClusterStats, cs)
+	}
+	return req
+}
+
+// localityToPB converts l to its envoy.api.v2.core.Locality wire representation.
+func localityToPB(l Locality) *corepb.Locality {
+	return &corepb.Locality{Region: l.Region, Zone: l.Zone, SubZone: l.SubZone}
+}
+
+// RecordOutcome records one DNS answer for cluster/locality as a success or an error,
+// for the next LRS report.
+func (c *Client) RecordOutcome(cluster string, locality Locality, success bool) {
+	c.lrsStats.Record(cluster, locality, success)
+}
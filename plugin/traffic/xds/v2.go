@@ -0,0 +1,190 @@
+package xds
+
+import (
+	"context"
+	"net"
+
+	xdspb "github.com/envoyproxy/go-control-plane/envoy/api/v2"
+	corepb "github.com/envoyproxy/go-control-plane/envoy/api/v2/core"
+	adsgrpc "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v2"
+	"github.com/golang/protobuf/ptypes"
+)
+
+// sotwClientV2 implements apiClient for the v2 State-of-the-World ADS protocol:
+// StreamAggregatedResources exchanging full-snapshot DiscoveryRequest/DiscoveryResponse.
+type sotwClientV2 struct {
+	c      *Client
+	stream adsgrpc.AggregatedDiscoveryService_StreamAggregatedResourcesClient
+}
+
+func newSotwClientV2(c *Client) (apiClient, error) { return &sotwClientV2{c: c}, nil }
+
+func (s *sotwClientV2) Run(ctx context.Context) error {
+	cli := adsgrpc.NewAggregatedDiscoveryServiceClient(s.c.cc)
+	stream, err := cli.StreamAggregatedResources(ctx)
+	if err != nil {
+		return err
+	}
+	s.stream = stream
+	return nil
+}
+
+func (s *sotwClientV2) Close() {
+	if s.stream != nil {
+		s.stream.CloseSend()
+	}
+}
+
+func (s *sotwClientV2) SendRequest(typeURL string, names []string, errDetail error) error {
+	if names == nil {
+		names = s.c.versions.names(typeURL)
+	} else {
+		s.c.versions.setNames(typeURL, names)
+	}
+	req := &xdspb.DiscoveryRequest{
+		Node:          s.c.node,
+		TypeUrl:       typeURL,
+		ResourceNames: names,
+		VersionInfo:   s.c.versions.version(typeURL),
+		ResponseNonce: s.c.versions.nonce(typeURL),
+	}
+	if errDetail != nil {
+		req.ErrorDetail = statusFromErr(errDetail)
+	}
+	return s.stream.Send(req)
+}
+
+func (s *sotwClientV2) RecvResponse() (*discoveryResponse, error) {
+	resp, err := s.stream.Recv()
+	if err != nil {
+		return nil, err
+	}
+
+	out := &discoveryResponse{typeURL: resp.GetTypeUrl(), version: resp.GetVersionInfo(), nonce: resp.GetNonce()}
+
+	switch resp.GetTypeUrl() {
+	case clusterTypeURLv2:
+		for _, r := range resp.GetResources() {
+			var any ptypes.DynamicAny
+			if err := ptypes.UnmarshalAny(r, &any); err != nil {
+				out.parseErr = err
+				continue
+			}
+			cl, ok := any.Message.(*xdspb.Cluster)
+			if !ok {
+				continue
+			}
+			out.clusters = append(out.clusters, clusterFromV2(cl))
+		}
+	case endpointTypeURLv2:
+		out.assignments = make(map[string]*clusterLoadAssignment)
+		for _, r := range resp.GetResources() {
+			var any ptypes.DynamicAny
+			if err := ptypes.UnmarshalAny(r, &any); err != nil {
+				out.parseErr = err
+				continue
+			}
+			cla, ok := any.Message.(*xdspb.ClusterLoadAssignment)
+			if !ok {
+				continue
+			}
+			out.assignments[cla.GetClusterName()] = claFromV2(cla)
+		}
+	}
+	return out, nil
+}
+
+func (s *sotwClientV2) HandleResponse(resp *discoveryResponse) error {
+	if resp.parseErr != nil {
+		log.Warningf("NACKing %s: %s", resp.typeURL, resp.parseErr)
+		s.c.versions.setNonce(resp.typeURL, resp.nonce)
+		return s.SendRequest(resp.typeURL, nil, resp.parseErr)
+	}
+	if err := s.c.applyResponse(resp); err != nil {
+		return err
+	}
+	return s.SendRequest(resp.typeURL, nil, nil)
+}
+
+// clusterFromV2 reads the discovery type (and, for DNS-type clusters, the hostnames
+// and refresh rate; for EDS clusters, whether eds_config follows our own ADS stream)
+// out of a v2 Cluster.
+func clusterFromV2(cl *xdspb.Cluster) cluster {
+	out := cluster{name: cl.GetName()}
+
+	switch cl.GetType() {
+	case xdspb.Cluster_STRICT_DNS:
+		out.typ = clusterStrictDNS
+	case xdspb.Cluster_LOGICAL_DNS:
+		out.typ = clusterLogicalDNS
+	case xdspb.Cluster_EDS:
+		out.typ = clusterEDS
+		out.edsViaADS = cl.GetEdsClusterConfig().GetEdsConfig().GetAds() != nil
+	default:
+		out.typ = clusterOther
+	}
+
+	if out.typ == clusterStrictDNS || out.typ == clusterLogicalDNS {
+		for _, le := range cl.GetLoadAssignment().GetEndpoints() {
+			for _, lb := range le.GetLbEndpoints() {
+				if host := lb.GetEndpoint().GetAddress().GetSocketAddress().GetAddress(); host != "" {
+					out.dnsHostnames = append(out.dnsHostnames, host)
+				}
+			}
+		}
+		out.dnsRefreshRate = dnsRefreshRateOf(cl.GetDnsRefreshRate())
+	}
+	return out
+}
+
+// claFromV2 turns a v2 ClusterLoadAssignment into the priority/locality/weight shape
+// Select needs to run Envoy's locality-weighted, priority-failover LB policy.
+func claFromV2(cla *xdspb.ClusterLoadAssignment) *clusterLoadAssignment {
+	out := newClusterLoadAssignment()
+	if of := cla.GetPolicy().GetOverprovisioningFactor(); of != nil {
+		out.overprovisioningFactor = of.GetValue()
+	}
+
+	for _, le := range cla.GetEndpoints() {
+		loc := le.GetLocality()
+		locality := &localityEndpoints{
+			locality: Locality{Region: loc.GetRegion(), Zone: loc.GetZone(), SubZone: loc.GetSubZone()},
+			weight:   le.GetLoadBalancingWeight().GetValue(),
+		}
+		if locality.weight == 0 {
+			locality.weight = 1
+		}
+
+		var healthyWeight, totalWeight uint32
+		for _, lb := range le.GetLbEndpoints() {
+			addr := lb.GetEndpoint().GetAddress().GetSocketAddress().GetAddress()
+			ip := net.ParseIP(addr)
+			if ip == nil {
+				continue
+			}
+			weight := lb.GetLoadBalancingWeight().GetValue()
+			if weight == 0 {
+				weight = 1
+			}
+			totalWeight += weight
+
+			switch lb.GetHealthStatus() {
+			case corepb.HealthStatus_HEALTHY, corepb.HealthStatus_UNKNOWN:
+				healthyWeight += weight
+			default:
+				continue // not selectable
+			}
+			locality.endpoints = append(locality.endpoints, weightedEndpoint{ip: ip, weight: weight})
+		}
+
+		pl, ok := out.priorities[le.GetPriority()]
+		if !ok {
+			pl = &priorityLevel{}
+			out.priorities[le.GetPriority()] = pl
+		}
+		pl.localities = append(pl.localities, locality)
+		pl.healthyWeight += uint64(healthyWeight)
+		pl.totalWeight += uint64(totalWeight)
+	}
+	return out
+}
@@ -0,0 +1,189 @@
+package xds
+
+import (
+	"context"
+	"net"
+
+	clusterpb "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	corepb "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	endpointpb "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+	adsgrpc "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	"github.com/golang/protobuf/ptypes"
+)
+
+// sotwClientV3 implements apiClient for the v3 State-of-the-World ADS protocol. It
+// mirrors sotwClientV2 exactly, only the proto packages differ.
+type sotwClientV3 struct {
+	c      *Client
+	stream adsgrpc.AggregatedDiscoveryService_StreamAggregatedResourcesClient
+}
+
+func newSotwClientV3(c *Client) (apiClient, error) { return &sotwClientV3{c: c}, nil }
+
+func (s *sotwClientV3) Run(ctx context.Context) error {
+	cli := adsgrpc.NewAggregatedDiscoveryServiceClient(s.c.cc)
+	stream, err := cli.StreamAggregatedResources(ctx)
+	if err != nil {
+		return err
+	}
+	s.stream = stream
+	return nil
+}
+
+func (s *sotwClientV3) Close() {
+	if s.stream != nil {
+		s.stream.CloseSend()
+	}
+}
+
+func (s *sotwClientV3) SendRequest(typeURL string, names []string, errDetail error) error {
+	if names == nil {
+		names = s.c.versions.names(typeURL)
+	} else {
+		s.c.versions.setNames(typeURL, names)
+	}
+	req := &adsgrpc.DiscoveryRequest{
+		Node:          s.c.node3,
+		TypeUrl:       typeURL,
+		ResourceNames: names,
+		VersionInfo:   s.c.versions.version(typeURL),
+		ResponseNonce: s.c.versions.nonce(typeURL),
+	}
+	if errDetail != nil {
+		req.ErrorDetail = statusFromErr(errDetail)
+	}
+	return s.stream.Send(req)
+}
+
+func (s *sotwClientV3) RecvResponse() (*discoveryResponse, error) {
+	resp, err := s.stream.Recv()
+	if err != nil {
+		return nil, err
+	}
+
+	out := &discoveryResponse{typeURL: resp.GetTypeUrl(), version: resp.GetVersionInfo(), nonce: resp.GetNonce()}
+
+	switch resp.GetTypeUrl() {
+	case clusterTypeURLv3:
+		for _, r := range resp.GetResources() {
+			var any ptypes.DynamicAny
+			if err := ptypes.UnmarshalAny(r, &any); err != nil {
+				out.parseErr = err
+				continue
+			}
+			cl, ok := any.Message.(*clusterpb.Cluster)
+			if !ok {
+				continue
+			}
+			out.clusters = append(out.clusters, clusterFromV3(cl))
+		}
+	case endpointTypeURLv3:
+		out.assignments = make(map[string]*clusterLoadAssignment)
+		for _, r := range resp.GetResources() {
+			var any ptypes.DynamicAny
+			if err := ptypes.UnmarshalAny(r, &any); err != nil {
+				out.parseErr = err
+				continue
+			}
+			cla, ok := any.Message.(*endpointpb.ClusterLoadAssignment)
+			if !ok {
+				continue
+			}
+			out.assignments[cla.GetClusterName()] = claFromV3(cla)
+		}
+	}
+	return out, nil
+}
+
+func (s *sotwClientV3) HandleResponse(resp *discoveryResponse) error {
+	if resp.parseErr != nil {
+		log.Warningf("NACKing %s: %s", resp.typeURL, resp.parseErr)
+		s.c.versions.setNonce(resp.typeURL, resp.nonce)
+		return s.SendRequest(resp.typeURL, nil, resp.parseErr)
+	}
+	if err := s.c.applyResponse(resp); err != nil {
+		return err
+	}
+	return s.SendRequest(resp.typeURL, nil, nil)
+}
+
+// clusterFromV3 is clusterFromV2 for the v3 Cluster type.
+func clusterFromV3(cl *clusterpb.Cluster) cluster {
+	out := cluster{name: cl.GetName()}
+
+	switch cl.GetType() {
+	case clusterpb.Cluster_STRICT_DNS:
+		out.typ = clusterStrictDNS
+	case clusterpb.Cluster_LOGICAL_DNS:
+		out.typ = clusterLogicalDNS
+	case clusterpb.Cluster_EDS:
+		out.typ = clusterEDS
+		out.edsViaADS = cl.GetEdsClusterConfig().GetEdsConfig().GetAds() != nil
+	default:
+		out.typ = clusterOther
+	}
+
+	if out.typ == clusterStrictDNS || out.typ == clusterLogicalDNS {
+		for _, le := range cl.GetLoadAssignment().GetEndpoints() {
+			for _, lb := range le.GetLbEndpoints() {
+				if host := lb.GetEndpoint().GetAddress().GetSocketAddress().GetAddress(); host != "" {
+					out.dnsHostnames = append(out.dnsHostnames, host)
+				}
+			}
+		}
+		out.dnsRefreshRate = dnsRefreshRateOf(cl.GetDnsRefreshRate())
+	}
+	return out
+}
+
+// claFromV3 turns a v3 ClusterLoadAssignment into the priority/locality/weight shape
+// Select needs to run Envoy's locality-weighted, priority-failover LB policy.
+func claFromV3(cla *endpointpb.ClusterLoadAssignment) *clusterLoadAssignment {
+	out := newClusterLoadAssignment()
+	if of := cla.GetPolicy().GetOverprovisioningFactor(); of != nil {
+		out.overprovisioningFactor = of.GetValue()
+	}
+
+	for _, le := range cla.GetEndpoints() {
+		loc := le.GetLocality()
+		locality := &localityEndpoints{
+			locality: Locality{Region: loc.GetRegion(), Zone: loc.GetZone(), SubZone: loc.GetSubZone()},
+			weight:   le.GetLoadBalancingWeight().GetValue(),
+		}
+		if locality.weight == 0 {
+			locality.weight = 1
+		}
+
+		var healthyWeight, totalWeight uint32
+		for _, lb := range le.GetLbEndpoints() {
+			addr := lb.GetEndpoint().GetAddress().GetSocketAddress().GetAddress()
+			ip := net.ParseIP(addr)
+			if ip == nil {
+				continue
+			}
+			weight := lb.GetLoadBalancingWeight().GetValue()
+			if weight == 0 {
+				weight = 1
+			}
+			totalWeight += weight
+
+			switch lb.GetHealthStatus() {
+			case corepb.HealthStatus_HEALTHY, corepb.HealthStatus_UNKNOWN:
+				healthyWeight += weight
+			default:
+				continue // not selectable
+			}
+			locality.endpoints = append(locality.endpoints, weightedEndpoint{ip: ip, weight: weight})
+		}
+
+		pl, ok := out.priorities[le.GetPriority()]
+		if !ok {
+			pl = &priorityLevel{}
+			out.priorities[le.GetPriority()] = pl
+		}
+		pl.localities = append(pl.localities, locality)
+		pl.healthyWeight += uint64(healthyWeight)
+		pl.totalWeight += uint64(totalWeight)
+	}
+	return out
+}
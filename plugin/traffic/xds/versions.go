@@ -0,0 +1,70 @@
+package xds
+
+import "sync"
+
+// versionTracker remembers, per TypeURL, the last version_info/nonce the client saw so
+// SotW requests (including ACKs) can be built without threading that state through
+// every call site. Delta uses resourceVersions instead, since it tracks per-resource
+// versions rather than one version per TypeURL.
+type versionTracker struct {
+	mu    sync.Mutex
+	byURL map[string]versionState
+}
+
+type versionState struct {
+	version string
+	nonce   string
+	names   []string // the resource_names last subscribed to for this TypeURL
+}
+
+func newVersionTracker() *versionTracker {
+	return &versionTracker{byURL: make(map[string]versionState)}
+}
+
+// update records a newly-accepted version/nonce for typeURL. It does not touch names,
+// since the subscription set doesn't change just because a new version arrived.
+func (v *versionTracker) update(typeURL, version, nonce string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	s := v.byURL[typeURL]
+	s.version, s.nonce = version, nonce
+	v.byURL[typeURL] = s
+}
+
+// setNonce records the nonce to echo in the next request for typeURL, without
+// touching the last-accepted version - used when NACKing.
+func (v *versionTracker) setNonce(typeURL, nonce string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	s := v.byURL[typeURL]
+	s.nonce = nonce
+	v.byURL[typeURL] = s
+}
+
+// setNames records the resource_names subscribed to for typeURL, so a later ACK/NACK
+// can echo the same subscription instead of guessing at it.
+func (v *versionTracker) setNames(typeURL string, names []string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	s := v.byURL[typeURL]
+	s.names = names
+	v.byURL[typeURL] = s
+}
+
+func (v *versionTracker) version(typeURL string) string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.byURL[typeURL].version
+}
+
+func (v *versionTracker) nonce(typeURL string) string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.byURL[typeURL].nonce
+}
+
+func (v *versionTracker) names(typeURL string) []string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.byURL[typeURL].names
+}